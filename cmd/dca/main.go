@@ -1,138 +1,74 @@
+// Command dca wraps the dca package to provide the historical command line
+// interface: a simple program that shells out to ffmpeg and outputs framed
+// Opus data, or decodes such data back to raw PCM.
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"image/jpeg"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
 	"image/png"
 	"io"
 	"os"
 	"os/exec"
 	"strconv"
-	"sync"
 
-	"layeh.com/gopus"
-)
-
-// Define constants
-const (
-	// The current version of the DCA format
-	FormatVersion int8 = 1
-
-	// The name of the DCA distribution
-	ProgramName string = "dca_for_dphp"
-
-	// The current version of the DCA distribution
-	ProgramVersion string = "0.0.1"
-
-	// The URL to the GitHub repository of the DCA distribution
-	GitHubRepositoryURL string = "https://github.com/davidcole1340/dca"
-
-	// Name of the author(s) of the DCA distribution
-	ProgramAuthor string = "bwmarrin, davidcole1340"
+	"github.com/key2peace/dca"
 )
 
 // All global variables used within the program
 var (
-	// Buffer for some commands
-	CmdBuf bytes.Buffer
-	PngBuf bytes.Buffer
-
-	CoverImage string
-
-	// Metadata structures
-	Metadata    MetadataStruct
-	FFprobeData FFprobeMetadata
-
 	// Encode or Decode
 	Mode string
 
-	// Magic bytes to write at the start of a DCA file
-	MagicBytes string = fmt.Sprintf("DCA%d", FormatVersion)
-
-	// 1 for mono, 2 for stereo
-	Channels int
-
-	// Must be one of 8000, 12000, 16000, 24000, or 48000.
-	// Discord only uses 48000 currently.
-	FrameRate int
+	InFile string
 
-	// Rates from 1000 to 512000 bits per second are meaningful
-	// Discord only uses 8000 to 384000 and default is 64000
-	Bitrate int
+	Wait bool
 
-	// Must be one of voip, audio, or lowdelay.
-	// DCA defaults to audio which is ideal for music
-	// Not sure what Discord uses here, probably voip
-	Application string
-
-	// if true, dca sends raw output without any magic bytes or json metadata
-	RawOutput bool
-
-	FrameSize int // uint16 size of each audio frame
-	MaxBytes  int // max size of opus data
-
-	Volume int // change audio volume (256=normal)
-
-	OpusEncoder *gopus.Encoder
-	OpusDecoder *gopus.Decoder
-
-	InFile      string
-	CoverFormat string = "jpeg"
-
-	OutFile string = "pipe:1"
-	OutBuf  []byte
-	Wait    bool
-
-	EncodeInputChan  chan []int16
-	EncodeOutputChan chan []byte
-
-	DecodeInputChan  chan []byte
-	DecodeOutputChan chan []int16
-
-	err error
-
-	wg sync.WaitGroup
+	opts = dca.StdEncodeOptions()
 )
 
 // init configures and parses the command line arguments
 func init() {
-
 	flag.StringVar(&Mode, "mode", "encode", "encode or decode")
 	flag.StringVar(&InFile, "i", "pipe:0", "infile")
-	flag.IntVar(&Volume, "vol", 256, "change audio volume (256=normal)")
-	flag.IntVar(&Channels, "ac", 2, "audio channels")
-	flag.IntVar(&FrameRate, "ar", 48000, "audio sampling rate")
-	flag.IntVar(&FrameSize, "as", 960, "audio frame size can be 960 (20ms), 1920 (40ms), or 2880 (60ms)")
-	flag.IntVar(&Bitrate, "ab", 64, "audio encoding bitrate in kb/s can be 1 - 512")
-	flag.BoolVar(&RawOutput, "raw", false, "Raw opus output (no metadata or magic bytes)")
-	flag.StringVar(&Application, "aa", "audio", "audio application can be voip, audio, or lowdelay")
-	flag.StringVar(&CoverFormat, "cf", "jpeg", "format the cover art will be encoded with")
+	flag.IntVar(&opts.Volume, "vol", opts.Volume, "change audio volume (256=normal)")
+	flag.IntVar(&opts.Channels, "ac", opts.Channels, "audio channels")
+	flag.IntVar(&opts.FrameRate, "ar", opts.FrameRate, "audio sampling rate")
+	flag.IntVar(&opts.FrameSize, "as", opts.FrameSize, "audio frame size can be 960 (20ms), 1920 (40ms), or 2880 (60ms)")
+	flag.IntVar(&opts.Bitrate, "ab", opts.Bitrate, "audio encoding bitrate in kb/s can be 1 - 512")
+	flag.BoolVar(&opts.RawOutput, "raw", false, "Raw opus output (no metadata or magic bytes)")
+	flag.StringVar(&opts.Application, "aa", opts.Application, "audio application can be voip, audio, or lowdelay")
+	flag.StringVar(&opts.CoverFormat, "cf", opts.CoverFormat, "format the cover art will be encoded with")
+	flag.StringVar(&opts.Container, "container", opts.Container, "container format to use, can be dca or ogg")
+	flag.BoolVar(&opts.VBR, "vbr", opts.VBR, "use variable bitrate encoding")
+	flag.BoolVar(&opts.CVBR, "cvbr", opts.CVBR, "constrained variable bitrate (recorded in file metadata only, not applied to the encoder)")
+	flag.BoolVar(&opts.FEC, "fec", opts.FEC, "in-band FEC (recorded in file metadata only, not applied to the encoder)")
+	flag.BoolVar(&opts.DTX, "dtx", opts.DTX, "discontinuous transmission (recorded in file metadata only, not applied to the encoder)")
+	flag.IntVar(&opts.PacketLoss, "plp", opts.PacketLoss, "expected packet loss percentage, 0-100 (recorded in file metadata only, not applied to the encoder)")
+	flag.IntVar(&opts.Complexity, "complexity", opts.Complexity, "encoder complexity, 0-10 (recorded in file metadata only, not applied to the encoder)")
+	flag.StringVar(&opts.MaxBandwidth, "maxbandwidth", opts.MaxBandwidth, "narrow, medium, wide, superwide, or full (recorded in file metadata only, not applied to the encoder)")
 	flag.BoolVar(&Wait, "w", false, "don't exit when the encoding has finished")
+}
 
+// very simple program that wraps ffmpeg and outputs raw opus data frames
+// with a uint16 header for each frame with the frame length in bytes
+func main() {
+	// Parsing the flags is deferred from init() to here, rather than parsed
+	// as the flags are registered, so that importing this package (e.g. from
+	// a test binary, which registers and parses its own -test.* flags) does
+	// not also consume or choke on the test binary's arguments.
 	if len(os.Args) < 2 {
 		flag.Usage()
 		os.Exit(1)
 	}
-
 	flag.Parse()
 
-	MaxBytes = (FrameSize * Channels) * 2 // max size of opus data
-}
-
-// very simple program that wraps ffmpeg and outputs raw opus data frames
-// with a uint16 header for each frame with the frame length in bytes
-func main() {
-
-	//////////////////////////////////////////////////////////////////////////
-	// BLOCK : Basic setup and validation
-	//////////////////////////////////////////////////////////////////////////
-
 	// If only one argument provided assume it's a filename.
 	if len(os.Args) == 2 {
 		InFile = os.Args[1]
@@ -140,7 +76,6 @@ func main() {
 
 	// If reading from a file, verify it exists.
 	if InFile != "pipe:0" {
-
 		if _, err := os.Stat(InFile); os.IsNotExist(err) {
 			fmt.Println("error: infile does not exist")
 			flag.Usage()
@@ -164,419 +99,270 @@ func main() {
 		}
 	}
 
-	//////////////////////////////////////////////////////////////////////////
-	// BLOCK : Create chans, buffers, and encoder for use
-	//////////////////////////////////////////////////////////////////////////
+	switch Mode {
+	case "encode":
+		encode()
+	default:
+		decode()
+	}
+
+	// if the wait flag is set, don't exit
+	for Wait {
+	}
+}
 
-	// create an opusEncoder to use
-	OpusEncoder, err = gopus.NewEncoder(FrameRate, Channels, gopus.Audio)
+// encode opens InFile (or stdin), runs it through the dca encoder, and
+// streams the framed output to stdout.
+func encode() {
+	var in io.Reader = os.Stdin
+	if InFile != "pipe:0" {
+		f, err := os.Open(InFile)
+		if err != nil {
+			fmt.Println("error opening infile:", err)
+			return
+		}
+		defer f.Close()
+		in = f
+	}
+
+	session, err := dca.NewEncoder(in, *opts)
 	if err != nil {
 		fmt.Println("NewEncoder Error:", err)
 		return
 	}
 
-	// set opus encoding options
-	//	OpusEncoder.SetVbr(true)                // bool
+	if !opts.RawOutput && InFile != "pipe:0" {
+		session.SetMetadata(gatherMetadata(InFile))
+	}
 
-	if Bitrate < 1 || Bitrate > 512 {
-		Bitrate = 64 // Set to Discord default
+	if _, err := io.Copy(os.Stdout, session); err != nil {
+		fmt.Println("error writing output:", err)
+		return
 	}
-	OpusEncoder.SetBitrate(Bitrate * 1000)
-
-	switch Application {
-	case "voip":
-		OpusEncoder.SetApplication(gopus.Voip)
-	case "audio":
-		OpusEncoder.SetApplication(gopus.Audio)
-	case "lowdelay":
-		OpusEncoder.SetApplication(gopus.RestrictedLowDelay)
-	default:
-		OpusEncoder.SetApplication(gopus.Audio)
+
+	if err := session.Error(); err != nil {
+		fmt.Println(err)
 	}
+}
 
-	// create an opusDecoder to use
-	OpusDecoder, err = gopus.NewDecoder(FrameRate, Channels)
+// decode reads framed Opus data from stdin and writes decoded PCM to
+// stdout.
+func decode() {
+	session, err := dca.NewDecoder(os.Stdin)
 	if err != nil {
 		fmt.Println("NewDecoder Error:", err)
 		return
 	}
 
-	EncodeOutputChan = make(chan []byte, 10)
-	EncodeInputChan = make(chan []int16, 10)
-
-	DecodeOutputChan = make(chan []int16, 10)
-	DecodeInputChan = make(chan []byte, 10)
-
-	if RawOutput == false && Mode == "encode" {
-		// Setup the metadata
-		Metadata = MetadataStruct{
-			Dca: &DCAMetadata{
-				Version: FormatVersion,
-				Tool: &DCAToolMetadata{
-					Name:    ProgramName,
-					Version: ProgramVersion,
-					Url:     GitHubRepositoryURL,
-					Author:  ProgramAuthor,
-				},
-			},
-			SongInfo: &SongMetadata{},
-			Origin:   &OriginMetadata{},
-			Opus: &OpusMetadata{
-				Bitrate:     Bitrate * 1000,
-				SampleRate:  FrameRate,
-				Application: Application,
-				FrameSize:   FrameSize,
-				Channels:    Channels,
-			},
-			Extra: &ExtraMetadata{},
-		}
-		_ = Metadata
-
-		// get ffprobe data
-		if InFile != "pipe:0" {
-			ffprobe := exec.Command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", InFile)
-			ffprobe.Stdout = &CmdBuf
-
-			err = ffprobe.Start()
-			if err != nil {
-				fmt.Println("RunStart Error:", err)
-				return
-			}
-
-			err = ffprobe.Wait()
-			if err != nil {
-				fmt.Println("FFprobe Error:", err)
-				return
-			}
-
-			err = json.Unmarshal(CmdBuf.Bytes(), &FFprobeData)
-			if err != nil {
-				fmt.Println("Erorr unmarshaling the FFprobe JSON:", err)
-				return
-			}
-
-			bitrateInt, err := strconv.Atoi(FFprobeData.Format.Bitrate)
-			if err != nil {
-				fmt.Println("Could not convert bitrate to int:", err)
-				return
-			}
-
-			if FFprobeData.Format.Tags != nil {
-				Metadata.SongInfo = &SongMetadata{
-					Title:    FFprobeData.Format.Tags.Title,
-					Artist:   FFprobeData.Format.Tags.Artist,
-					Album:    FFprobeData.Format.Tags.Album,
-					Genre:    FFprobeData.Format.Tags.Genre,
-					Comments: "", // change later?
-				}
-			}
-
-			Metadata.Origin = &OriginMetadata{
-				Source:   "file",
-				Bitrate:  bitrateInt,
-				Channels: Channels,
-				Encoding: FFprobeData.Format.FormatLongName,
-			}
-
-			CmdBuf.Reset()
-
-			// get cover art
-			cover := exec.Command("ffmpeg", "-loglevel", "0", "-i", InFile, "-f", "singlejpeg", "pipe:1")
-			cover.Stdout = &CmdBuf
-
-			err = cover.Start()
-			if err != nil {
-				fmt.Println("RunStart Error:", err)
-				return
-			}
-
-			err = cover.Wait()
-			if err == nil {
-				buf := bytes.NewBufferString(CmdBuf.String())
-
-				if CoverFormat == "png" {
-					img, err := jpeg.Decode(buf)
-					if err == nil { // silently drop it, no image
-						err = png.Encode(&PngBuf, img)
-						if err == nil {
-							CoverImage = base64.StdEncoding.EncodeToString(PngBuf.Bytes())
-						}
-					}
-				} else {
-					CoverImage = base64.StdEncoding.EncodeToString(CmdBuf.Bytes())
-				}
-
-				Metadata.SongInfo.Cover = &CoverImage
-			}
-
-			CmdBuf.Reset()
-			PngBuf.Reset()
-		} else {
-			Metadata.Origin = &OriginMetadata{
-				Source:   "pipe",
-				Channels: Channels,
-				Encoding: "pcm16/s16le",
-			}
-		}
+	if _, err := io.Copy(os.Stdout, session); err != nil {
+		fmt.Println("error writing output:", err)
+		return
 	}
 
-	//////////////////////////////////////////////////////////////////////////
-	// BLOCK : Start reader and writer workers
-	//////////////////////////////////////////////////////////////////////////
-
-	wg.Add(3)
+	if err := session.Error(); err != nil {
+		fmt.Println(err)
+	}
+}
 
-	if Mode == "encode" {
-		go encodeReader()
-		go encoder()
-		go encodeWriter()
-	} else {
-		go decodeReader()
-		go decoder()
-		go decodeWriter()
+// gatherMetadata runs ffprobe and ffmpeg against infile to build the DCA
+// song metadata, mirroring the original tool's behavior.
+func gatherMetadata(infile string) *dca.MetadataStruct {
+	metadata := &dca.MetadataStruct{
+		Dca: &dca.DCAMetadata{
+			Version: dca.FormatVersion,
+			Tool: &dca.DCAToolMetadata{
+				Name:    dca.ProgramName,
+				Version: dca.ProgramVersion,
+				Url:     dca.GitHubRepositoryURL,
+				Author:  dca.ProgramAuthor,
+			},
+		},
+		SongInfo: &dca.SongMetadata{},
+		Origin:   &dca.OriginMetadata{},
+		Opus: &dca.OpusMetadata{
+			Bitrate:      opts.Bitrate * 1000,
+			SampleRate:   opts.FrameRate,
+			Application:  opts.Application,
+			FrameSize:    opts.FrameSize,
+			Channels:     opts.Channels,
+			VBR:          opts.VBR,
+			CVBR:         opts.CVBR,
+			FEC:          opts.FEC,
+			DTX:          opts.DTX,
+			PacketLoss:   opts.PacketLoss,
+			Complexity:   opts.Complexity,
+			MaxBandwidth: opts.MaxBandwidth,
+		},
+		Extra: &dca.ExtraMetadata{},
 	}
 
-	// wait for above goroutines to finish, then exit.
-	wg.Wait()
+	var cmdBuf bytes.Buffer
+	var ffprobeData dca.FFprobeMetadata
 
-	// if the wait flag is set, don't exit
-	for Wait {
+	ffprobe := exec.Command("ffprobe", "-v", "quiet", "-print_format", "json",
+		"-show_format", "-show_streams", "-show_chapters", infile)
+	ffprobe.Stdout = &cmdBuf
 
+	if err := ffprobe.Run(); err != nil {
+		fmt.Println("FFprobe Error:", err)
+		return metadata
 	}
-}
-
-// encodeReader reads from the input
-func encodeReader() {
-	defer func() {
-		close(EncodeInputChan)
-		wg.Done()
-	}()
 
-	// read from file
-	if InFile != "pipe:0" {
-
-		// Create a shell command "object" to run.
-		ffmpeg := exec.Command("ffmpeg", "-i", InFile, "-vol", strconv.Itoa(Volume), "-f", "s16le", "-ar", strconv.Itoa(FrameRate), "-ac", strconv.Itoa(Channels), "pipe:1")
-		stdout, err := ffmpeg.StdoutPipe()
-		if err != nil {
-			fmt.Println("StdoutPipe Error:", err)
-			return
-		}
+	if err := json.Unmarshal(cmdBuf.Bytes(), &ffprobeData); err != nil {
+		fmt.Println("Error unmarshaling the FFprobe JSON:", err)
+		return metadata
+	}
 
-		// Starts the ffmpeg command
-		err = ffmpeg.Start()
-		if err != nil {
-			fmt.Println("RunStart Error:", err)
-			return
-		}
+	bitrateInt, err := strconv.Atoi(ffprobeData.Format.Bitrate)
+	if err != nil {
+		fmt.Println("Could not convert bitrate to int:", err)
+		return metadata
+	}
 
-		for {
+	if ffprobeData.Format.Tags != nil {
+		metadata.SongInfo = songInfoFromTags(ffprobeData.Format.Tags)
+	}
 
-			// read data from ffmpeg stdout
-			InBuf := make([]int16, FrameSize*Channels)
-			err = binary.Read(stdout, binary.LittleEndian, &InBuf)
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			if err != nil {
-				fmt.Println("error reading from ffmpeg stdout :", err)
-				return
-			}
+	// Lyrics are sometimes stored as chapter titles (e.g. synced USLT
+	// converted to chapters) rather than a format tag; fall back to
+	// concatenating them if no format-level lyrics tag was found.
+	if metadata.SongInfo.Lyrics == "" {
+		metadata.SongInfo.Lyrics = lyricsFromChapters(ffprobeData.Chapters)
+	}
 
-			// write pcm data to the EncodeInputChan
-			EncodeInputChan <- InBuf
+	metadata.Origin = &dca.OriginMetadata{
+		Source:   "file",
+		Bitrate:  bitrateInt,
+		Channels: opts.Channels,
+		Encoding: ffprobeData.Format.FormatLongName,
+	}
 
+	if audio := firstAudioStream(ffprobeData.Streams); audio != nil {
+		metadata.Origin.CodecName = audio.CodecName
+		metadata.Origin.CodecLongName = audio.CodecLongName
+		if sampleRate, err := strconv.Atoi(audio.SampleRate); err == nil {
+			metadata.Origin.SampleRate = sampleRate
 		}
 	}
 
-	// read input from stdin pipe
-	if InFile == "pipe:0" {
-
-		// 16KB input buffer
-		rbuf := bufio.NewReaderSize(os.Stdin, 16384)
-		for {
-
-			// read data from stdin
-			InBuf := make([]int16, FrameSize*Channels)
+	gatherCoverArt(infile, ffprobeData.Streams, metadata.SongInfo)
 
-			err = binary.Read(rbuf, binary.LittleEndian, &InBuf)
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				return
-			}
-			if err != nil {
-				fmt.Println("error reading from ffmpeg stdout :", err)
-				return
-			}
+	return metadata
+}
 
-			// write pcm data to the EncodeInputChan
-			EncodeInputChan <- InBuf
-		}
+// songInfoFromTags maps an ffprobe format tags object onto a SongMetadata.
+func songInfoFromTags(tags *dca.FFprobeTags) *dca.SongMetadata {
+	return &dca.SongMetadata{
+		Title:       tags.Title,
+		Artist:      tags.Artist,
+		Album:       tags.Album,
+		Genre:       tags.Genre,
+		Comments:    "", // change later?
+		TrackNumber: tags.Track,
+		DiscNumber:  tags.Disc,
+		Date:        tags.Date,
+		Composer:    tags.Composer,
+		AlbumArtist: tags.AlbumArtist,
+		Lyrics:      tags.Lyrics,
+
+		ReplayGainTrackGain: tags.ReplayGainTrackGain,
+		ReplayGainTrackPeak: tags.ReplayGainTrackPeak,
+		ReplayGainAlbumGain: tags.ReplayGainAlbumGain,
+		ReplayGainAlbumPeak: tags.ReplayGainAlbumPeak,
 	}
-
 }
 
-// encoder listens on the EncodeInputChan and encodes provided PCM16 data
-// to opus, then sends the encoded data to the EncodeOutputChan
-func encoder() {
-	defer func() {
-		close(EncodeOutputChan)
-		wg.Done()
-	}()
-
-	for {
-		pcm, ok := <-EncodeInputChan
-		if !ok {
-			// if chan closed, exit
-			return
+// firstAudioStream returns the first audio stream in streams, used to pull
+// the source codec's details into OriginMetadata, or nil if none is found.
+func firstAudioStream(streams []dca.FFprobeStream) *dca.FFprobeStream {
+	for i, stream := range streams {
+		if stream.CodecType == "audio" {
+			return &streams[i]
 		}
-
-		// try encoding pcm frame with Opus
-		opus, err := OpusEncoder.Encode(pcm, FrameSize, MaxBytes)
-		if err != nil {
-			fmt.Println("Encoding Error:", err)
-			return
-		}
-
-		// write opus data to EncodeOutputChan
-		EncodeOutputChan <- opus
 	}
+	return nil
 }
 
-// encodeWriter listens on the EncodeOutputChan and writes the output to stdout pipe
-// TODO: Add support for writing directly to a file
-func encodeWriter() {
-	defer wg.Done()
-
-	var opuslen int16
-	var jsonlen int32
-
-	// 16KB output buffer
-	wbuf := bufio.NewWriterSize(os.Stdout, 16384)
-	defer wbuf.Flush()
-
-	if RawOutput == false {
-		// write the magic bytes
-		fmt.Print(MagicBytes)
-
-		// encode and write json length
-		json, err := json.Marshal(Metadata)
-		if err != nil {
-			fmt.Println("Failed to encode the Metadata JSON:", err)
-			return
+// lyricsFromChapters concatenates chapter titles, used as a fallback source
+// of lyrics when the format tags don't carry one directly.
+func lyricsFromChapters(chapters []dca.FFprobeChapter) string {
+	var lyrics string
+	for _, chapter := range chapters {
+		if chapter.Tags != nil && chapter.Tags.Title != "" {
+			lyrics += chapter.Tags.Title + "\n"
 		}
-
-		jsonlen = int32(len(json))
-		err = binary.Write(wbuf, binary.LittleEndian, &jsonlen)
-		if err != nil {
-			fmt.Println("error writing output: ", err)
-			return
-		}
-
-		// write the actual json
-		wbuf.Write(json)
 	}
+	return lyrics
+}
 
-	for {
-		opus, ok := <-EncodeOutputChan
-		if !ok {
-			// if chan closed, exit
-			return
+// gatherCoverArt extracts every attached_pic stream in streams from infile
+// and appends it to info.Covers, also populating the legacy info.Cover
+// field with the first cover found for backward compatibility.
+func gatherCoverArt(infile string, streams []dca.FFprobeStream, info *dca.SongMetadata) {
+	for _, stream := range streams {
+		if stream.CodecType != "video" || stream.Disposition == nil || stream.Disposition.AttachedPic == 0 {
+			continue
 		}
 
-		// write header
-		opuslen = int16(len(opus))
-		err = binary.Write(wbuf, binary.LittleEndian, &opuslen)
-		if err != nil {
-			fmt.Println("error writing output: ", err)
-			return
-		}
+		var cmdBuf bytes.Buffer
+		extract := exec.Command("ffmpeg", "-loglevel", "0", "-i", infile,
+			"-map", fmt.Sprintf("0:%d", stream.Index), "-c", "copy", "-f", "image2pipe", "pipe:1")
+		extract.Stdout = &cmdBuf
 
-		// write opus data to stdout
-		err = binary.Write(wbuf, binary.LittleEndian, &opus)
-		if err != nil {
-			fmt.Println("error writing output: ", err)
-			return
+		if err := extract.Run(); err != nil {
+			continue
 		}
-	}
-}
-
-func decodeReader() {
-	defer func() {
-		close(DecodeInputChan)
-		wg.Done()
-	}()
 
-	// 16KB input buffer
-	rbuf := bufio.NewReaderSize(os.Stdin, 16384)
-	var opuslen uint16
+		mimeType := coverMIMEType(stream)
+		data := cmdBuf.Bytes()
 
-	for {
-		// read "header" from dca
-		err = binary.Read(rbuf, binary.LittleEndian, &opuslen)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			return
-		}
-		if err != nil {
-			fmt.Println("error reading from stdin:", err)
-			return
+		if opts.CoverFormat == "png" && mimeType != "image/png" {
+			if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+				var pngBuf bytes.Buffer
+				if err := png.Encode(&pngBuf, img); err == nil {
+					data = pngBuf.Bytes()
+					mimeType = "image/png"
+				}
+			}
+			// if decoding fails (e.g. an image format Go can't decode),
+			// fall back to embedding the cover in its original format.
 		}
 
-		// read data from stdin
-		InBuf := make([]byte, opuslen)
-		err = binary.Read(rbuf, binary.LittleEndian, &InBuf)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			return
+		kind := "cover"
+		if stream.Tags != nil && stream.Tags.Comment != "" {
+			kind = stream.Tags.Comment
 		}
-		if err != nil {
-			fmt.Println("error reading from stdin:", err)
-			return
-		}
-
-		DecodeInputChan <- InBuf
-	}
-}
 
-func decoder() {
-	defer func() {
-		close(DecodeOutputChan)
-		wg.Done()
-	}()
+		encoded := base64.StdEncoding.EncodeToString(data)
+		info.Covers = append(info.Covers, dca.CoverArt{
+			MIMEType: mimeType,
+			Kind:     kind,
+			Data:     encoded,
+		})
 
-	for {
-		opus, ok := <-DecodeInputChan
-		if !ok {
-			return
-		}
-
-		// try decoding opus frame with Opus
-		pcm, err := OpusDecoder.Decode(opus, FrameSize, false)
-		if err != nil {
-			fmt.Println("Decoding Error:", err)
-			return
+		if info.Cover == nil {
+			info.Cover = &encoded
 		}
-
-		DecodeOutputChan <- pcm
 	}
 }
 
-func decodeWriter() {
-	defer wg.Done()
-
-	// 16KB output buffer
-	wbuf := bufio.NewWriterSize(os.Stdout, 16384)
-	defer wbuf.Flush()
-
-	for {
-		pcm, ok := <-DecodeOutputChan
-		if !ok {
-			return
-		}
+// coverMIMEType guesses the MIME type of an attached_pic stream from its
+// ffprobe codec name, falling back to the stream tags' own mimetype.
+func coverMIMEType(stream dca.FFprobeStream) string {
+	switch stream.CodecName {
+	case "mjpeg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	case "gif":
+		return "image/gif"
+	case "bmp":
+		return "image/bmp"
+	}
 
-		// write pcm
-		err = binary.Write(wbuf, binary.LittleEndian, &pcm)
-		if err != nil {
-			fmt.Println("error writing output:", err)
-			return
-		}
+	if stream.Tags != nil && stream.Tags.MimeType != "" {
+		return stream.Tags.MimeType
 	}
+
+	return "application/octet-stream"
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/key2peace/dca"
+)
+
+func TestSongInfoFromTags(t *testing.T) {
+	tags := &dca.FFprobeTags{
+		Title:       "Test Title",
+		Artist:      "Test Artist",
+		Album:       "Test Album",
+		Genre:       "Test Genre",
+		Track:       "3",
+		Disc:        "1",
+		Date:        "2026",
+		Composer:    "Test Composer",
+		AlbumArtist: "Test Album Artist",
+		Lyrics:      "la la la",
+
+		ReplayGainTrackGain: "-3.00 dB",
+		ReplayGainTrackPeak: "0.99",
+		ReplayGainAlbumGain: "-4.00 dB",
+		ReplayGainAlbumPeak: "0.98",
+	}
+
+	got := songInfoFromTags(tags)
+
+	want := &dca.SongMetadata{
+		Title:       "Test Title",
+		Artist:      "Test Artist",
+		Album:       "Test Album",
+		Genre:       "Test Genre",
+		TrackNumber: "3",
+		DiscNumber:  "1",
+		Date:        "2026",
+		Composer:    "Test Composer",
+		AlbumArtist: "Test Album Artist",
+		Lyrics:      "la la la",
+
+		ReplayGainTrackGain: "-3.00 dB",
+		ReplayGainTrackPeak: "0.99",
+		ReplayGainAlbumGain: "-4.00 dB",
+		ReplayGainAlbumPeak: "0.98",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("songInfoFromTags = %+v, want %+v", *got, *want)
+	}
+}
+
+func TestLyricsFromChapters(t *testing.T) {
+	cases := []struct {
+		name     string
+		chapters []dca.FFprobeChapter
+		want     string
+	}{
+		{
+			name:     "no chapters",
+			chapters: nil,
+			want:     "",
+		},
+		{
+			name: "chapters without titles",
+			chapters: []dca.FFprobeChapter{
+				{Tags: nil},
+				{Tags: &dca.FFprobeChapterTags{Title: ""}},
+			},
+			want: "",
+		},
+		{
+			name: "titled chapters are concatenated in order",
+			chapters: []dca.FFprobeChapter{
+				{Tags: &dca.FFprobeChapterTags{Title: "Verse one"}},
+				{Tags: nil},
+				{Tags: &dca.FFprobeChapterTags{Title: "Verse two"}},
+			},
+			want: "Verse one\nVerse two\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := lyricsFromChapters(c.chapters)
+			if got != c.want {
+				t.Errorf("lyricsFromChapters() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFirstAudioStream(t *testing.T) {
+	audio := dca.FFprobeStream{CodecType: "audio", CodecName: "flac", SampleRate: "44100"}
+	streams := []dca.FFprobeStream{
+		{CodecType: "video", CodecName: "mjpeg"},
+		audio,
+		{CodecType: "audio", CodecName: "opus"},
+	}
+
+	got := firstAudioStream(streams)
+	if got == nil || *got != audio {
+		t.Fatalf("firstAudioStream = %+v, want %+v", got, audio)
+	}
+
+	if got := firstAudioStream([]dca.FFprobeStream{{CodecType: "video"}}); got != nil {
+		t.Fatalf("firstAudioStream with no audio streams = %+v, want nil", got)
+	}
+}
+
+func TestCoverMIMEType(t *testing.T) {
+	cases := []struct {
+		name   string
+		stream dca.FFprobeStream
+		want   string
+	}{
+		{"mjpeg", dca.FFprobeStream{CodecName: "mjpeg"}, "image/jpeg"},
+		{"png", dca.FFprobeStream{CodecName: "png"}, "image/png"},
+		{"gif", dca.FFprobeStream{CodecName: "gif"}, "image/gif"},
+		{"bmp", dca.FFprobeStream{CodecName: "bmp"}, "image/bmp"},
+		{
+			name: "unknown codec falls back to stream tag mimetype",
+			stream: dca.FFprobeStream{
+				CodecName: "other",
+				Tags:      &dca.FFprobeStreamTags{MimeType: "image/webp"},
+			},
+			want: "image/webp",
+		},
+		{
+			name:   "unknown codec with no tags falls back to octet-stream",
+			stream: dca.FFprobeStream{CodecName: "other"},
+			want:   "application/octet-stream",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := coverMIMEType(c.stream)
+			if got != c.want {
+				t.Errorf("coverMIMEType(%+v) = %q, want %q", c.stream, got, c.want)
+			}
+		})
+	}
+}
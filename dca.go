@@ -0,0 +1,28 @@
+// Package dca implements a streaming encoder and decoder for the DCA audio
+// format, plus an Ogg Opus container mode, so callers can produce or consume
+// Discord-ready Opus audio without shelling out to a separate CLI.
+package dca
+
+import "fmt"
+
+// Define constants
+const (
+	// FormatVersion is the current version of the DCA format
+	FormatVersion int8 = 1
+
+	// ProgramName is the name of the DCA distribution
+	ProgramName string = "dca_for_dphp"
+
+	// ProgramVersion is the current version of the DCA distribution
+	ProgramVersion string = "0.0.1"
+
+	// GitHubRepositoryURL is the URL to the GitHub repository of the DCA distribution
+	GitHubRepositoryURL string = "https://github.com/davidcole1340/dca"
+
+	// ProgramAuthor is the name of the author(s) of the DCA distribution
+	ProgramAuthor string = "bwmarrin, davidcole1340"
+)
+
+// MagicBytes are the bytes written at the start of a DCA file, identifying
+// the format version.
+var MagicBytes = fmt.Sprintf("DCA%d", FormatVersion)
@@ -0,0 +1,243 @@
+package dca
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"layeh.com/gopus"
+)
+
+// DecodeSession is a streaming Opus decoder. It auto-detects whether r holds
+// a DCA file (magic bytes + JSON metadata followed by framed Opus), a raw
+// Ogg Opus bitstream, or bare length-prefixed Opus frames, and makes the
+// decoded audio available either frame-by-frame via OpusFrame or as raw
+// PCM16/LE via Read.
+type DecodeSession struct {
+	sync.Mutex
+
+	r       *bufio.Reader
+	oggr    *oggReader
+	decoder *gopus.Decoder
+
+	frameSize  int
+	channels   int
+	sampleRate int
+
+	metadata *MetadataStruct
+
+	running    bool
+	err        error
+	framesRead int
+
+	pcmBuf []byte
+}
+
+// NewDecoder creates a new DecodeSession that reads and decodes Opus audio
+// from r.
+func NewDecoder(r io.Reader) (*DecodeSession, error) {
+	s := &DecodeSession{
+		r:          bufio.NewReaderSize(r, 16384),
+		frameSize:  960,
+		channels:   2,
+		sampleRate: 48000,
+		running:    true,
+	}
+
+	container, err := s.detectContainer()
+	if err != nil {
+		return nil, err
+	}
+
+	if container == "ogg" {
+		s.oggr = newOggReader(s.r)
+		if err := s.skipOggHeaders(); err != nil {
+			return nil, err
+		}
+	}
+
+	decoder, err := gopus.NewDecoder(s.sampleRate, s.channels)
+	if err != nil {
+		return nil, fmt.Errorf("dca: failed to create opus decoder: %w", err)
+	}
+	s.decoder = decoder
+
+	return s, nil
+}
+
+// detectContainer peeks at the start of the stream to tell a DCA file, an
+// Ogg bitstream, and bare framed Opus apart, consuming the DCA header if
+// present.
+func (s *DecodeSession) detectContainer() (string, error) {
+	magic, err := s.r.Peek(4)
+	if err != nil {
+		if err == io.EOF {
+			return "dca", nil
+		}
+		return "", fmt.Errorf("dca: failed to read stream header: %w", err)
+	}
+
+	if string(magic) == "OggS" {
+		return "ogg", nil
+	}
+
+	if string(magic) != MagicBytes {
+		return "dca", nil
+	}
+
+	if _, err := s.r.Discard(len(MagicBytes)); err != nil {
+		return "", err
+	}
+
+	var jsonlen int32
+	if err := binary.Read(s.r, binary.LittleEndian, &jsonlen); err != nil {
+		return "", fmt.Errorf("dca: failed to read metadata length: %w", err)
+	}
+
+	data := make([]byte, jsonlen)
+	if _, err := io.ReadFull(s.r, data); err != nil {
+		return "", fmt.Errorf("dca: failed to read metadata: %w", err)
+	}
+
+	md := &MetadataStruct{}
+	if err := json.Unmarshal(data, md); err != nil {
+		return "", fmt.Errorf("dca: failed to unmarshal metadata: %w", err)
+	}
+
+	s.metadata = md
+	if md.Opus != nil {
+		s.frameSize = md.Opus.FrameSize
+		s.channels = md.Opus.Channels
+		s.sampleRate = md.Opus.SampleRate
+	}
+
+	return "dca", nil
+}
+
+// skipOggHeaders discards the OpusHead and OpusTags packets at the start of
+// an Ogg Opus stream and fills in the channel count from OpusHead; the frame
+// size and sample rate keep their defaults.
+func (s *DecodeSession) skipOggHeaders() error {
+	head, err := s.oggr.nextPacket()
+	if err != nil {
+		return fmt.Errorf("dca: failed to read ogg id header: %w", err)
+	}
+	if len(head) >= 10 {
+		s.channels = int(head[9])
+	}
+
+	if _, err := s.oggr.nextPacket(); err != nil {
+		return fmt.Errorf("dca: failed to read ogg comment header: %w", err)
+	}
+
+	return nil
+}
+
+// OpusFrame blocks until the next raw (still-encoded) Opus frame is
+// available, or returns io.EOF once the stream is exhausted.
+func (s *DecodeSession) OpusFrame() ([]byte, error) {
+	if s.oggr != nil {
+		frame, err := s.oggr.nextPacket()
+		if err != nil {
+			return nil, s.fail(err)
+		}
+
+		s.Lock()
+		s.framesRead++
+		s.Unlock()
+
+		return frame, nil
+	}
+
+	var opuslen uint16
+	if err := binary.Read(s.r, binary.LittleEndian, &opuslen); err != nil {
+		return nil, s.fail(err)
+	}
+
+	frame := make([]byte, opuslen)
+	if _, err := io.ReadFull(s.r, frame); err != nil {
+		return nil, s.fail(err)
+	}
+
+	s.Lock()
+	s.framesRead++
+	s.Unlock()
+
+	return frame, nil
+}
+
+// fail normalizes err to io.EOF on a clean end of stream, records it as the
+// session's terminal error otherwise, and marks the session as no longer
+// running.
+func (s *DecodeSession) fail(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.running = false
+	if err != io.EOF {
+		s.err = err
+	}
+
+	return err
+}
+
+// FrameDuration returns the playback duration of a single Opus frame.
+func (s *DecodeSession) FrameDuration() time.Duration {
+	return time.Second * time.Duration(s.frameSize) / time.Duration(s.sampleRate)
+}
+
+// Running reports whether the session can still produce frames.
+func (s *DecodeSession) Running() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.running
+}
+
+// Error returns the error that stopped the session, if any.
+func (s *DecodeSession) Error() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.err
+}
+
+// Read implements io.Reader, yielding decoded PCM16/LE audio.
+//
+// There is no FEC recovery support: EncodeOptions.FEC is recorded in a
+// file's metadata but layeh.com/gopus has no binding for
+// OPUS_SET_INBAND_FEC (see the comment in NewEncoder), so no encoder ever
+// actually writes redundant data for a decoder to recover from. A fec=true
+// Decode call only reconstructs the *previous* packet from redundancy
+// carried by the *current* one, which would require a second Decode call
+// per signalled loss to also recover the current packet's own audio, on
+// top of the missing encoder support - so there's nothing to wire up here
+// yet.
+func (s *DecodeSession) Read(p []byte) (int, error) {
+	for len(s.pcmBuf) == 0 {
+		frame, err := s.OpusFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		pcm, err := s.decoder.Decode(frame, s.frameSize, false)
+		if err != nil {
+			return 0, fmt.Errorf("dca: opus decode error: %w", err)
+		}
+
+		buf := make([]byte, len(pcm)*2)
+		for i, sample := range pcm {
+			binary.LittleEndian.PutUint16(buf[i*2:], uint16(sample))
+		}
+		s.pcmBuf = buf
+	}
+
+	n := copy(p, s.pcmBuf)
+	s.pcmBuf = s.pcmBuf[n:]
+	return n, nil
+}
@@ -0,0 +1,569 @@
+package dca
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"layeh.com/gopus"
+)
+
+// EncodeSession is a streaming Opus encoder. It reads PCM audio from the
+// reader passed to NewEncoder (transcoding it with ffmpeg unless
+// EncodeOptions.RawStdin is set), encodes it to Opus, and makes the result
+// available either frame-by-frame via OpusFrame or as a framed byte stream
+// via Read.
+type EncodeSession struct {
+	sync.Mutex
+
+	options EncodeOptions
+	encoder *gopus.Encoder
+	source  io.Reader
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// cond is signalled whenever start() swaps in a fresh opusChan (a
+	// Seek completing or failing), so OpusFrame can tell a pipeline
+	// hand-off from a genuine end of stream instead of misreading the old,
+	// now-closed channel as EOF.
+	cond     *sync.Cond
+	seeking  bool
+	opusChan chan []byte
+	resumeCh chan struct{}
+	paused   bool
+	seekBase time.Duration
+
+	running    bool
+	err        error
+	framesRead int
+
+	metadata    *MetadataStruct
+	oggw        *oggWriter
+	wroteHeader bool
+	readBuf     bytes.Buffer
+	granule     int64
+	oggPending  []byte
+	oggHasPend  bool
+}
+
+// NewEncoder creates a new EncodeSession that reads from r. Unless
+// opts.RawStdin is set, r is piped through ffmpeg so it can accept anything
+// ffmpeg understands (mp3, a raw file, etc). The session starts
+// encoding immediately in the background; call Stop to cancel it early.
+func NewEncoder(r io.Reader, opts EncodeOptions) (*EncodeSession, error) {
+	opts.setDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	application := gopus.Audio
+	switch opts.Application {
+	case "voip":
+		application = gopus.Voip
+	case "lowdelay":
+		application = gopus.RestrictedLowDelay
+	}
+
+	encoder, err := gopus.NewEncoder(opts.FrameRate, opts.Channels, application)
+	if err != nil {
+		return nil, fmt.Errorf("dca: failed to create opus encoder: %w", err)
+	}
+	encoder.SetBitrate(opts.Bitrate * 1000)
+	encoder.SetVbr(opts.VBR)
+
+	// layeh.com/gopus only exposes an encoder_ctl surface for
+	// SetVbr/SetBitrate/SetApplication (plus ResetState); it has no
+	// bindings for OPUS_SET_VBR_CONSTRAINT, OPUS_SET_INBAND_FEC,
+	// OPUS_SET_DTX, OPUS_SET_PACKET_LOSS_PERC, OPUS_SET_COMPLEXITY, or
+	// OPUS_SET_MAX_BANDWIDTH, so CVBR/FEC/DTX/PacketLoss/Complexity/
+	// MaxBandwidth can't actually be pushed into the C encoder through this
+	// dependency. They're still validated and recorded in OpusMetadata
+	// below so the chosen values travel with the file, but until gopus (or
+	// a fork of it) grows the missing ctl bindings, encoding itself only
+	// honors Bitrate, VBR, and Application.
+
+	s := &EncodeSession{
+		options:  opts,
+		encoder:  encoder,
+		source:   r,
+		resumeCh: closedChan(),
+	}
+	s.cond = sync.NewCond(&s.Mutex)
+
+	if !opts.RawOutput {
+		s.metadata = &MetadataStruct{
+			Dca: &DCAMetadata{
+				Version: FormatVersion,
+				Tool: &DCAToolMetadata{
+					Name:    ProgramName,
+					Version: ProgramVersion,
+					Url:     GitHubRepositoryURL,
+					Author:  ProgramAuthor,
+				},
+			},
+			SongInfo: &SongMetadata{},
+			Origin: &OriginMetadata{
+				Source:   "pipe",
+				Channels: opts.Channels,
+				Encoding: "pcm16/s16le",
+			},
+			Opus: &OpusMetadata{
+				Bitrate:      opts.Bitrate * 1000,
+				SampleRate:   opts.FrameRate,
+				Application:  opts.Application,
+				FrameSize:    opts.FrameSize,
+				Channels:     opts.Channels,
+				VBR:          opts.VBR,
+				CVBR:         opts.CVBR,
+				FEC:          opts.FEC,
+				DTX:          opts.DTX,
+				PacketLoss:   opts.PacketLoss,
+				Complexity:   opts.Complexity,
+				MaxBandwidth: opts.MaxBandwidth,
+			},
+			Extra: &ExtraMetadata{},
+		}
+	}
+
+	s.start(r, 0)
+
+	return s, nil
+}
+
+// closedChan returns an already-closed channel, used as the initial
+// (not-paused) value of resumeCh.
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// start launches the ffmpeg/read/encode pipeline reading from r, seeking to
+// startAt before the first frame is produced. It is used both by NewEncoder
+// and by Seek, which tears down the previous pipeline and calls start again.
+func (s *EncodeSession) start(r io.Reader, startAt time.Duration) {
+	s.Lock()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.opusChan = make(chan []byte, 10)
+	s.seekBase = startAt
+	s.framesRead = 0
+	s.running = true
+	s.err = nil
+	s.seeking = false
+	ctx := s.ctx
+	s.cond.Broadcast()
+	s.Unlock()
+
+	pcmChan := make(chan []int16, 10)
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.readPCM(ctx, r, startAt, pcmChan)
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.encodePCM(ctx, pcmChan)
+	}()
+}
+
+// readPCM feeds raw PCM frames read from r (or from ffmpeg's stdout, if
+// transcoding) into out, closing out once the source is exhausted or ctx is
+// cancelled.
+func (s *EncodeSession) readPCM(ctx context.Context, r io.Reader, seekTo time.Duration, out chan<- []int16) {
+	defer close(out)
+
+	if s.options.RawStdin {
+		s.readRawPCM(ctx, r, out)
+		return
+	}
+
+	args := []string{}
+	if seekTo > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", seekTo.Seconds()))
+	}
+	args = append(args,
+		"-i", "pipe:0",
+		"-vol", strconv.Itoa(s.options.Volume),
+		"-f", "s16le",
+		"-ar", strconv.Itoa(s.options.FrameRate),
+		"-ac", strconv.Itoa(s.options.Channels),
+		"pipe:1",
+	)
+
+	ffmpeg := exec.CommandContext(ctx, "ffmpeg", args...)
+	ffmpeg.Stdin = r
+
+	stdout, err := ffmpeg.StdoutPipe()
+	if err != nil {
+		s.fail(fmt.Errorf("dca: failed to open ffmpeg stdout: %w", err))
+		return
+	}
+
+	if err := ffmpeg.Start(); err != nil {
+		s.fail(fmt.Errorf("dca: failed to start ffmpeg: %w", err))
+		return
+	}
+
+	s.readRawPCM(ctx, stdout, out)
+
+	ffmpeg.Wait()
+}
+
+// readRawPCM reads fixed-size PCM16/LE frames from r into out, stopping
+// early if ctx is cancelled.
+func (s *EncodeSession) readRawPCM(ctx context.Context, r io.Reader, out chan<- []int16) {
+	rbuf := bufio.NewReaderSize(r, 16384)
+
+	for {
+		pcm := make([]int16, s.options.FrameSize*s.options.Channels)
+		if err := binary.Read(rbuf, binary.LittleEndian, &pcm); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				s.fail(fmt.Errorf("dca: error reading pcm: %w", err))
+			}
+			return
+		}
+
+		select {
+		case out <- pcm:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// encodePCM reads PCM frames from in, encodes them with Opus, and pushes
+// the result onto s.opusChan, stopping early if ctx is cancelled.
+func (s *EncodeSession) encodePCM(ctx context.Context, in <-chan []int16) {
+	s.Lock()
+	opusChan := s.opusChan
+	s.Unlock()
+	defer close(opusChan)
+
+	maxBytes := (s.options.FrameSize * s.options.Channels) * 2
+
+	for pcm := range in {
+		opus, err := s.encoder.Encode(pcm, s.options.FrameSize, maxBytes)
+		if err != nil {
+			s.fail(fmt.Errorf("dca: opus encode error: %w", err))
+			return
+		}
+
+		select {
+		case opusChan <- opus:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fail records err as the session's terminal error and marks it no longer
+// running, unless it was already stopped or failed.
+func (s *EncodeSession) fail(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.running = false
+	if s.err == nil && s.ctx.Err() == nil {
+		s.err = err
+	}
+}
+
+// OpusFrame blocks until the next encoded Opus frame is available, or
+// returns io.EOF once encoding has finished. While the session is paused it
+// blocks until Pause(false) is called.
+func (s *EncodeSession) OpusFrame() ([]byte, error) {
+	for {
+		s.Lock()
+		resumeCh, opusChan := s.resumeCh, s.opusChan
+		s.Unlock()
+
+		<-resumeCh
+
+		frame, ok := <-opusChan
+		if ok {
+			s.Lock()
+			s.framesRead++
+			s.Unlock()
+			return frame, nil
+		}
+
+		s.Lock()
+		if s.opusChan != opusChan {
+			// start() already swapped in a fresh pipeline (a Seek
+			// completed) while we were waiting; retry against it instead
+			// of reporting the old, superseded channel's closure as EOF.
+			s.Unlock()
+			continue
+		}
+		if s.seeking {
+			// A Seek is tearing down the old pipeline but hasn't called
+			// start() yet; wait for it to either finish (cond.Broadcast
+			// in start()) or fail (cond.Broadcast in Seek).
+			s.cond.Wait()
+			s.Unlock()
+			continue
+		}
+
+		err := s.err
+		s.running = false
+		s.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// Stop cancels encoding, killing the ffmpeg subprocess if one is running,
+// and unblocks any goroutine parked in OpusFrame or Read, including one
+// waiting on a paused session. It is safe to call more than once.
+func (s *EncodeSession) Stop() error {
+	s.Lock()
+	s.running = false
+	cancel := s.cancel
+	if s.paused {
+		s.paused = false
+		close(s.resumeCh)
+	}
+	s.cond.Broadcast()
+	s.Unlock()
+
+	cancel()
+	return nil
+}
+
+// Pause pauses or resumes frame delivery from OpusFrame and Read. The
+// underlying pipeline keeps running, so the encoder's internal buffers will
+// fill and naturally backpressure ffmpeg while paused.
+func (s *EncodeSession) Pause(pause bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if pause == s.paused {
+		return
+	}
+	s.paused = pause
+
+	if pause {
+		s.resumeCh = make(chan struct{})
+	} else {
+		close(s.resumeCh)
+	}
+}
+
+// Paused reports whether the session is currently paused.
+func (s *EncodeSession) Paused() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.paused
+}
+
+// Seek restarts encoding from the given position in the source audio. It
+// requires the reader passed to NewEncoder to implement io.Seeker so it can
+// be rewound before ffmpeg re-reads it with -ss (with RawStdin, where there is
+// no ffmpeg, it is seeked straight to the requested sample). Concurrent OpusFrame/Read
+// callers are held at bay (not handed a spurious EOF) until the new
+// pipeline is in place, per the seeking/cond hand-off in OpusFrame.
+func (s *EncodeSession) Seek(to time.Duration) error {
+	seeker, ok := s.source.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("dca: seek requires the encoder's source to implement io.Seeker")
+	}
+
+	s.Lock()
+	cancel := s.cancel
+	s.seeking = true
+	s.Unlock()
+
+	cancel()
+	s.wg.Wait()
+
+	offset := int64(0)
+	if s.options.RawStdin {
+		samples := int64(to) * int64(s.options.FrameRate) / int64(time.Second)
+		offset = samples * int64(s.options.Channels) * 2
+	}
+
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		wrapped := fmt.Errorf("dca: failed to rewind source: %w", err)
+
+		s.Lock()
+		s.seeking = false
+		s.running = false
+		s.err = wrapped
+		s.cond.Broadcast()
+		s.Unlock()
+
+		return wrapped
+	}
+
+	s.start(s.source, to)
+
+	return nil
+}
+
+// PlaybackPosition returns how far into the source audio encoding has
+// progressed, based on frames emitted since the stream started or was last
+// sought.
+func (s *EncodeSession) PlaybackPosition() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	return s.seekBase + s.FrameDuration()*time.Duration(s.framesRead)
+}
+
+// FrameDuration returns the playback duration of a single Opus frame.
+func (s *EncodeSession) FrameDuration() time.Duration {
+	return time.Second * time.Duration(s.options.FrameSize) / time.Duration(s.options.FrameRate)
+}
+
+// Running reports whether the session is still producing frames.
+func (s *EncodeSession) Running() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.running
+}
+
+// Error returns the error that stopped the session, if any.
+func (s *EncodeSession) Error() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.err
+}
+
+// LastError is an alias for Error, kept for callers migrating off the
+// historical fmt.Println-based error reporting of the cmd/dca tool.
+func (s *EncodeSession) LastError() error {
+	return s.Error()
+}
+
+// SetMetadata overrides the DCA metadata that will be written ahead of the
+// first Opus frame, e.g. with song info gathered via ffprobe. In the DCA
+// container it has no effect once EncodeOptions.RawOutput is set; in the Ogg
+// container its SongInfo supplies the OpusTags comments either way. It must
+// be called before the first call to Read.
+func (s *EncodeSession) SetMetadata(md *MetadataStruct) {
+	s.Lock()
+	defer s.Unlock()
+	s.metadata = md
+}
+
+// Read implements io.Reader, yielding the session's output framed according
+// to EncodeOptions.Container: the DCA magic bytes and JSON metadata followed
+// by length-prefixed Opus frames (the default), or a standard Ogg Opus
+// bitstream when Container is "ogg". RawOutput skips the DCA header but
+// still emits length-prefixed frames.
+func (s *EncodeSession) Read(p []byte) (int, error) {
+	for s.readBuf.Len() == 0 {
+		if err := s.fillReadBuf(); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.readBuf.Read(p)
+}
+
+func (s *EncodeSession) fillReadBuf() error {
+	if s.options.Container == "ogg" {
+		return s.fillOggReadBuf()
+	}
+	return s.fillDCAReadBuf()
+}
+
+func (s *EncodeSession) fillDCAReadBuf() error {
+	if !s.wroteHeader {
+		s.wroteHeader = true
+
+		if !s.options.RawOutput {
+			s.readBuf.WriteString(MagicBytes)
+
+			data, err := json.Marshal(s.metadata)
+			if err != nil {
+				return fmt.Errorf("dca: failed to marshal metadata: %w", err)
+			}
+
+			var jsonlen [4]byte
+			binary.LittleEndian.PutUint32(jsonlen[:], uint32(len(data)))
+			s.readBuf.Write(jsonlen[:])
+			s.readBuf.Write(data)
+
+			return nil
+		}
+	}
+
+	frame, err := s.OpusFrame()
+	if err != nil {
+		return err
+	}
+
+	var opuslen [2]byte
+	binary.LittleEndian.PutUint16(opuslen[:], uint16(len(frame)))
+	s.readBuf.Write(opuslen[:])
+	s.readBuf.Write(frame)
+
+	return nil
+}
+
+func (s *EncodeSession) fillOggReadBuf() error {
+	if s.oggw == nil {
+		s.oggw = newOggWriter(&s.readBuf, rand.Uint32())
+
+		if err := s.oggw.writePacket(oggOpusHead(s.options.Channels, s.options.FrameRate), 0, oggHeaderBOS); err != nil {
+			return fmt.Errorf("dca: failed to write ogg id header: %w", err)
+		}
+
+		var songInfo *SongMetadata
+		if s.metadata != nil {
+			songInfo = s.metadata.SongInfo
+		}
+		if err := s.oggw.writePacket(oggOpusTags(songInfo), 0, 0); err != nil {
+			return fmt.Errorf("dca: failed to write ogg comment header: %w", err)
+		}
+
+		// Buffer one frame behind so the final page can be flagged EOS.
+		frame, err := s.OpusFrame()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == nil {
+			s.oggPending, s.oggHasPend = frame, true
+		}
+
+		return s.oggw.Flush()
+	}
+
+	if !s.oggHasPend {
+		return io.EOF
+	}
+
+	pending := s.oggPending
+	next, err := s.OpusFrame()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	s.granule += int64(s.options.FrameSize)
+	headerType := byte(0)
+	if err == io.EOF {
+		headerType = oggHeaderEOS
+		s.oggHasPend = false
+	} else {
+		s.oggPending = next
+	}
+
+	if werr := s.oggw.writePacket(pending, s.granule, headerType); werr != nil {
+		return fmt.Errorf("dca: failed to write ogg page: %w", werr)
+	}
+
+	return s.oggw.Flush()
+}
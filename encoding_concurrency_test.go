@@ -0,0 +1,93 @@
+package dca
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rawPCM builds numFrames silent PCM16/LE frames sized for opts, suitable as
+// a RawStdin source.
+func rawPCM(opts EncodeOptions, numFrames int) []byte {
+	var buf bytes.Buffer
+	frame := make([]int16, opts.FrameSize*opts.Channels)
+	for i := 0; i < numFrames; i++ {
+		binary.Write(&buf, binary.LittleEndian, frame)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeSessionStopUnblocksPausedReader(t *testing.T) {
+	opts := EncodeOptions{RawStdin: true, Channels: 2, FrameRate: 48000, FrameSize: 960, Bitrate: 64}
+	s, err := NewEncoder(bytes.NewReader(rawPCM(opts, 10)), opts)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+
+	s.Pause(true)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.OpusFrame()
+		done <- err
+	}()
+
+	// Give the goroutine a chance to actually park on the paused resumeCh
+	// before Stop is called.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OpusFrame blocked on a paused session did not unblock after Stop")
+	}
+}
+
+func TestEncodeSessionSeekDoesNotTruncateConcurrentReader(t *testing.T) {
+	opts := EncodeOptions{RawStdin: true, Channels: 2, FrameRate: 48000, FrameSize: 960, Bitrate: 64}
+	s, err := NewEncoder(bytes.NewReader(rawPCM(opts, 100)), opts)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+
+	var frames int64
+	readerDone := make(chan error, 1)
+	go func() {
+		for {
+			_, err := s.OpusFrame()
+			if err != nil {
+				readerDone <- err
+				return
+			}
+			atomic.AddInt64(&frames, 1)
+		}
+	}()
+
+	// Let a few frames flow before seeking back to the start concurrently
+	// with the OpusFrame reader above.
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Seek(0); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	select {
+	case err := <-readerDone:
+		if err != io.EOF {
+			t.Fatalf("OpusFrame reader ended with error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the post-seek stream to finish")
+	}
+
+	if atomic.LoadInt64(&frames) == 0 {
+		t.Fatal("no frames were received across the seek")
+	}
+}
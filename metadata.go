@@ -0,0 +1,177 @@
+package dca
+
+// MetadataStruct is the top level structure that is JSON encoded and placed
+// at the start of a DCA file.
+type MetadataStruct struct {
+	Dca      *DCAMetadata    `json:"dca"`
+	SongInfo *SongMetadata   `json:"info"`
+	Origin   *OriginMetadata `json:"origin"`
+	Opus     *OpusMetadata   `json:"opus"`
+	Extra    *ExtraMetadata  `json:"extra"`
+}
+
+// DCAMetadata holds information about the DCA format and the tool that
+// produced the file.
+type DCAMetadata struct {
+	Version int8             `json:"version"`
+	Tool    *DCAToolMetadata `json:"tool"`
+}
+
+// DCAToolMetadata describes the program that encoded the file.
+type DCAToolMetadata struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Url     string `json:"url"`
+	Author  string `json:"author"`
+}
+
+// SongMetadata holds information about the song itself, pulled from the
+// source file via ffprobe.
+type SongMetadata struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Genre       string `json:"genre"`
+	Comments    string `json:"comments"`
+	TrackNumber string `json:"track_number"`
+	DiscNumber  string `json:"disc_number"`
+	Date        string `json:"date"`
+	Composer    string `json:"composer"`
+	AlbumArtist string `json:"album_artist"`
+	Lyrics      string `json:"lyrics"`
+
+	ReplayGainTrackGain string `json:"replaygain_track_gain"`
+	ReplayGainTrackPeak string `json:"replaygain_track_peak"`
+	ReplayGainAlbumGain string `json:"replaygain_album_gain"`
+	ReplayGainAlbumPeak string `json:"replaygain_album_peak"`
+
+	// Cover holds the primary cover art, kept for backward compatibility
+	// with readers that predate the Covers slice.
+	Cover *string `json:"cover"`
+	// Covers holds every attached_pic stream found in the source file,
+	// e.g. front cover, back cover, and artist photo.
+	Covers []CoverArt `json:"covers,omitempty"`
+}
+
+// CoverArt describes a single embedded image, such as a front/back cover
+// or artist photo, pulled from an attached_pic stream.
+type CoverArt struct {
+	MIMEType string `json:"mime_type"`
+	Kind     string `json:"kind"`
+	Data     string `json:"data"`
+}
+
+// OriginMetadata holds information about where the source audio came from.
+type OriginMetadata struct {
+	Source   string `json:"source"`
+	Bitrate  int    `json:"bitrate"`
+	Channels int    `json:"channels"`
+	Encoding string `json:"encoding"`
+
+	// Codec details of the source audio stream itself, as opposed to
+	// Encoding (the container format), pulled from ffprobe's per-stream
+	// output.
+	CodecName     string `json:"codec_name"`
+	CodecLongName string `json:"codec_long_name"`
+	SampleRate    int    `json:"sample_rate"`
+}
+
+// OpusMetadata holds the Opus encoding parameters used to produce the file.
+type OpusMetadata struct {
+	Bitrate      int    `json:"bitrate"`
+	SampleRate   int    `json:"sample_rate"`
+	Application  string `json:"application"`
+	FrameSize    int    `json:"frame_size"`
+	Channels     int    `json:"channels"`
+	VBR          bool   `json:"vbr"`
+	CVBR         bool   `json:"cvbr"`
+	FEC          bool   `json:"fec"`
+	DTX          bool   `json:"dtx"`
+	PacketLoss   int    `json:"packet_loss_percent"`
+	Complexity   int    `json:"complexity"`
+	MaxBandwidth string `json:"max_bandwidth"`
+}
+
+// ExtraMetadata is a placeholder for any additional metadata not covered by
+// the other structures.
+type ExtraMetadata struct {
+}
+
+// FFprobeMetadata mirrors the JSON output of
+// `ffprobe -show_format -show_streams -show_chapters`.
+type FFprobeMetadata struct {
+	Format   *FFprobeFormat   `json:"format"`
+	Streams  []FFprobeStream  `json:"streams"`
+	Chapters []FFprobeChapter `json:"chapters"`
+}
+
+// FFprobeFormat mirrors the "format" object of ffprobe's JSON output.
+type FFprobeFormat struct {
+	Filename       string       `json:"filename"`
+	NbStreams      int          `json:"nb_streams"`
+	NbPrograms     int          `json:"nb_programs"`
+	FormatName     string       `json:"format_name"`
+	FormatLongName string       `json:"format_long_name"`
+	Duration       string       `json:"duration"`
+	Size           string       `json:"size"`
+	Bitrate        string       `json:"bit_rate"`
+	Tags           *FFprobeTags `json:"tags"`
+}
+
+// FFprobeTags mirrors the "tags" object nested under ffprobe's "format".
+type FFprobeTags struct {
+	Encoder     string `json:"encoder"`
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Genre       string `json:"genre"`
+	Track       string `json:"track"`
+	Disc        string `json:"disc"`
+	Date        string `json:"date"`
+	Composer    string `json:"composer"`
+	AlbumArtist string `json:"album_artist"`
+	Lyrics      string `json:"lyrics"`
+
+	ReplayGainTrackGain string `json:"REPLAYGAIN_TRACK_GAIN"`
+	ReplayGainTrackPeak string `json:"REPLAYGAIN_TRACK_PEAK"`
+	ReplayGainAlbumGain string `json:"REPLAYGAIN_ALBUM_GAIN"`
+	ReplayGainAlbumPeak string `json:"REPLAYGAIN_ALBUM_PEAK"`
+}
+
+// FFprobeStream mirrors one entry of the "streams" array of ffprobe's JSON
+// output.
+type FFprobeStream struct {
+	Index         int                 `json:"index"`
+	CodecName     string              `json:"codec_name"`
+	CodecLongName string              `json:"codec_long_name"`
+	CodecType     string              `json:"codec_type"`
+	SampleRate    string              `json:"sample_rate"`
+	Channels      int                 `json:"channels"`
+	BitRate       string              `json:"bit_rate"`
+	Disposition   *FFprobeDisposition `json:"disposition"`
+	Tags          *FFprobeStreamTags  `json:"tags"`
+}
+
+// FFprobeDisposition mirrors the "disposition" object nested under a
+// stream, used here to find attached_pic (embedded cover art) streams.
+type FFprobeDisposition struct {
+	AttachedPic int `json:"attached_pic"`
+}
+
+// FFprobeStreamTags mirrors the "tags" object nested under a stream.
+type FFprobeStreamTags struct {
+	MimeType string `json:"mimetype"`
+	Filename string `json:"filename"`
+	Comment  string `json:"comment"`
+}
+
+// FFprobeChapter mirrors one entry of the "chapters" array of ffprobe's
+// JSON output, used here to recover lyrics stored as chapter titles.
+type FFprobeChapter struct {
+	Tags *FFprobeChapterTags `json:"tags"`
+}
+
+// FFprobeChapterTags mirrors the "tags" object nested under a chapter.
+type FFprobeChapterTags struct {
+	Title string `json:"title"`
+}
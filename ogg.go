@@ -0,0 +1,249 @@
+package dca
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Ogg page header flags, see RFC 3533 section 6.
+const (
+	oggHeaderContinued byte = 0x01
+	oggHeaderBOS       byte = 0x02
+	oggHeaderEOS       byte = 0x04
+)
+
+// oggPreSkip is the number of samples (at 48kHz) a decoder should discard
+// from the start of the stream, as recommended by RFC 7845 for encoders
+// that do not otherwise need a priming delay.
+const oggPreSkip = 3840
+
+// oggCRCTable is the CRC32 lookup table for the polynomial used by the Ogg
+// container format (0x04C11DB7, MSB first, no reflection, no final XOR).
+var oggCRCTable = buildOggCRCTable()
+
+func buildOggCRCTable() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		reg := uint32(i) << 24
+		for bit := 0; bit < 8; bit++ {
+			if reg&0x80000000 != 0 {
+				reg = (reg << 1) ^ 0x04c11db7
+			} else {
+				reg <<= 1
+			}
+		}
+		table[i] = reg
+	}
+	return table
+}
+
+// oggCRC32 computes the checksum of an Ogg page with the CRC field treated
+// as zero, per RFC 3533.
+func oggCRC32(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = (crc << 8) ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggLacingValues returns the segment table lacing values for an Ogg
+// packet of the given length, using 255-byte lacing.
+func oggLacingValues(length int) []byte {
+	var segs []byte
+	for length >= 255 {
+		segs = append(segs, 255)
+		length -= 255
+	}
+	segs = append(segs, byte(length))
+	return segs
+}
+
+// oggWriter mux's a single logical Opus stream into Ogg pages, one packet
+// per page, matching the framing used by ffmpeg and opusenc.
+type oggWriter struct {
+	w       *bufio.Writer
+	serial  uint32
+	pageSeq uint32
+}
+
+func newOggWriter(w io.Writer, serial uint32) *oggWriter {
+	return &oggWriter{
+		w:      bufio.NewWriterSize(w, 16384),
+		serial: serial,
+	}
+}
+
+// writePacket wraps packet in a single Ogg page with the given granule
+// position and header flags.
+func (o *oggWriter) writePacket(packet []byte, granule int64, headerType byte) error {
+	segments := oggLacingValues(len(packet))
+	if len(segments) > 255 {
+		return fmt.Errorf("ogg: packet too large to fit in a single page (%d bytes)", len(packet))
+	}
+
+	page := make([]byte, 0, 27+len(segments)+len(packet))
+	page = append(page, 'O', 'g', 'g', 'S')
+	page = append(page, 0) // version
+	page = append(page, headerType)
+
+	granuleBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(granuleBuf, uint64(granule))
+	page = append(page, granuleBuf...)
+
+	serialBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(serialBuf, o.serial)
+	page = append(page, serialBuf...)
+
+	seqBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seqBuf, o.pageSeq)
+	page = append(page, seqBuf...)
+
+	page = append(page, 0, 0, 0, 0) // CRC, filled in below
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	page = append(page, packet...)
+
+	crc := oggCRC32(page)
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+
+	if _, err := o.w.Write(page); err != nil {
+		return err
+	}
+
+	o.pageSeq++
+	return nil
+}
+
+func (o *oggWriter) Flush() error {
+	return o.w.Flush()
+}
+
+// oggOpusHead builds the identification header packet described in
+// RFC 7845 section 5.1.
+func oggOpusHead(channels, sampleRate int) []byte {
+	head := make([]byte, 19)
+	copy(head[0:8], "OpusHead")
+	head[8] = 1 // version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:12], oggPreSkip)
+	binary.LittleEndian.PutUint32(head[12:16], uint32(sampleRate))
+	binary.LittleEndian.PutUint16(head[16:18], 0) // output gain
+	head[18] = 0                                  // channel mapping family
+	return head
+}
+
+// oggOpusTags builds the comment header packet described in RFC 7845
+// section 5.2, deriving the user comment list from the song metadata.
+func oggOpusTags(info *SongMetadata) []byte {
+	vendor := ProgramName + " " + ProgramVersion
+
+	var comments []string
+	if info != nil {
+		if info.Title != "" {
+			comments = append(comments, "TITLE="+info.Title)
+		}
+		if info.Artist != "" {
+			comments = append(comments, "ARTIST="+info.Artist)
+		}
+		if info.Album != "" {
+			comments = append(comments, "ALBUM="+info.Album)
+		}
+		if info.Genre != "" {
+			comments = append(comments, "GENRE="+info.Genre)
+		}
+	}
+
+	tags := make([]byte, 0, 16+len(vendor)+len(comments)*16)
+	tags = append(tags, "OpusTags"...)
+
+	vendorLen := make([]byte, 4)
+	binary.LittleEndian.PutUint32(vendorLen, uint32(len(vendor)))
+	tags = append(tags, vendorLen...)
+	tags = append(tags, vendor...)
+
+	commentCount := make([]byte, 4)
+	binary.LittleEndian.PutUint32(commentCount, uint32(len(comments)))
+	tags = append(tags, commentCount...)
+
+	for _, c := range comments {
+		clen := make([]byte, 4)
+		binary.LittleEndian.PutUint32(clen, uint32(len(c)))
+		tags = append(tags, clen...)
+		tags = append(tags, c...)
+	}
+
+	return tags
+}
+
+// oggReader demuxes packets out of an Ogg bitstream, reassembling packets
+// that were split across continued segments or batched several-per-page.
+type oggReader struct {
+	r       io.Reader
+	pending [][]byte
+	partial []byte
+}
+
+func newOggReader(r io.Reader) *oggReader {
+	return &oggReader{r: r}
+}
+
+// nextPacket returns the next complete packet from the stream, or io.EOF
+// once the stream is exhausted.
+func (o *oggReader) nextPacket() ([]byte, error) {
+	for len(o.pending) == 0 {
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+
+	packet := o.pending[0]
+	o.pending = o.pending[1:]
+	return packet, nil
+}
+
+// readPage reads one Ogg page and appends the packets it completes to
+// o.pending, carrying an in-progress packet over in o.partial.
+func (o *oggReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return err
+	}
+
+	if string(header[0:4]) != "OggS" {
+		return fmt.Errorf("ogg: invalid capture pattern")
+	}
+
+	headerType := header[5]
+	segCount := int(header[26])
+
+	segTable := make([]byte, segCount)
+	if _, err := io.ReadFull(o.r, segTable); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	if headerType&oggHeaderContinued == 0 {
+		o.partial = o.partial[:0]
+	}
+
+	for i := 0; i < segCount; i++ {
+		seg := make([]byte, segTable[i])
+		if _, err := io.ReadFull(o.r, seg); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		o.partial = append(o.partial, seg...)
+
+		// A lacing value less than 255 terminates the packet.
+		if segTable[i] < 255 {
+			o.pending = append(o.pending, o.partial)
+			o.partial = nil
+		}
+	}
+
+	return nil
+}
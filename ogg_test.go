@@ -0,0 +1,123 @@
+package dca
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestOggCRC32KnownPage(t *testing.T) {
+	// A minimal, hand-built Ogg page (capture pattern + version + header
+	// flags + zeroed granule/serial/seq + zeroed CRC + an empty segment
+	// table) whose CRC is easy to recompute by hand: the all-zero 27-byte
+	// header with no payload.
+	page := make([]byte, 27)
+	copy(page, "OggS")
+
+	got := oggCRC32(page)
+
+	// Recompute independently with the textbook bit-at-a-time CRC-32/Ogg
+	// algorithm (poly 0x04C11DB7, MSB first, no reflection, no final XOR)
+	// to confirm oggCRC32 and its table agree with the spec, not just with
+	// themselves.
+	want := slowOggCRC32(page)
+	if got != want {
+		t.Fatalf("oggCRC32 = %#x, want %#x", got, want)
+	}
+}
+
+// slowOggCRC32 is a reference implementation used only by the test, kept
+// deliberately distinct from oggCRCTable's generation code so a bug in the
+// table build wouldn't also hide in the "expected" value.
+func slowOggCRC32(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = (crc << 1) ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func TestOggLacingValues(t *testing.T) {
+	cases := []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0}},
+		{10, []byte{10}},
+		{254, []byte{254}},
+		{255, []byte{255, 0}},
+		{256, []byte{255, 1}},
+		{510, []byte{255, 255, 0}},
+		{765, []byte{255, 255, 255, 0}},
+	}
+
+	for _, c := range cases {
+		got := oggLacingValues(c.length)
+		if !bytes.Equal(got, c.want) {
+			t.Errorf("oggLacingValues(%d) = %v, want %v", c.length, got, c.want)
+		}
+	}
+}
+
+func TestOggWriterReaderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := newOggWriter(&buf, 0xdeadbeef)
+
+	packets := [][]byte{
+		oggOpusHead(2, 48000),
+		oggOpusTags(&SongMetadata{Title: "Test Song", Artist: "Test Artist"}),
+		bytes.Repeat([]byte{0x42}, 300), // exercises 255-byte lacing across two segments
+		[]byte("short frame"),
+	}
+
+	for i, p := range packets {
+		headerType := byte(0)
+		if i == 0 {
+			headerType = oggHeaderBOS
+		}
+		if i == len(packets)-1 {
+			headerType = oggHeaderEOS
+		}
+		if err := w.writePacket(p, int64(i*960), headerType); err != nil {
+			t.Fatalf("writePacket(%d): %v", i, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	r := newOggReader(bytes.NewReader(buf.Bytes()))
+	for i, want := range packets {
+		got, err := r.nextPacket()
+		if err != nil {
+			t.Fatalf("nextPacket(%d): %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("nextPacket(%d) = %v, want %v", i, got, want)
+		}
+	}
+
+	if _, err := r.nextPacket(); err != io.EOF {
+		t.Fatalf("nextPacket after last packet = %v, want io.EOF", err)
+	}
+}
+
+func TestOggWriterRejectsOversizedPacket(t *testing.T) {
+	var buf bytes.Buffer
+	w := newOggWriter(&buf, 1)
+
+	// A page's segment table holds at most 255 lacing values, so the
+	// largest packet that fits is 254*255+254 bytes; this one needs 256
+	// (255 full segments plus a terminating one).
+	huge := bytes.Repeat([]byte{0}, 255*255+1)
+	if err := w.writePacket(huge, 0, 0); err == nil {
+		t.Fatal("writePacket with an oversized packet should fail, got nil error")
+	}
+}
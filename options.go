@@ -0,0 +1,119 @@
+package dca
+
+import "fmt"
+
+// EncodeOptions is a set of options for encoding audio with NewEncoder.
+type EncodeOptions struct {
+	Volume       int    // change audio volume (256=normal)
+	Channels     int    // audio channels
+	FrameRate    int    // audio sampling rate
+	FrameSize    int    // audio frame size can be 960 (20ms), 1920 (40ms), or 2880 (60ms)
+	Bitrate      int    // audio encoding bitrate in kb/s can be 1 - 512
+	Application  string // audio application can be voip, audio, or lowdelay
+	CoverFormat  string // format the cover art will be encoded with
+	Container    string // container to write: "dca" (default) or "ogg"
+	VBR          bool   // use variable bitrate encoding
+	CVBR         bool   // constrained VBR; recorded in OpusMetadata only, not applied to the encoder
+	FEC          bool   // in-band forward error correction; recorded in OpusMetadata only, not applied to the encoder
+	DTX          bool   // discontinuous transmission; recorded in OpusMetadata only, not applied to the encoder
+	PacketLoss   int    // expected packet loss percentage, 0-100; recorded in OpusMetadata only, not applied to the encoder
+	Complexity   int    // encoder complexity, 0-10; recorded in OpusMetadata only, not applied to the encoder
+	MaxBandwidth string // narrow, medium, wide, superwide, or full; recorded in OpusMetadata only, not applied to the encoder
+	RawOutput    bool   // don't write magic bytes or JSON metadata, just framed opus
+	RawStdin     bool   // treat the input reader as raw pcm16/le and skip ffmpeg entirely
+}
+
+// StdEncodeOptions is a set of options that should be good for most use cases.
+func StdEncodeOptions() *EncodeOptions {
+	return &EncodeOptions{
+		Volume:       256,
+		Channels:     2,
+		FrameRate:    48000,
+		FrameSize:    960,
+		Bitrate:      64,
+		Application:  "audio",
+		CoverFormat:  "jpeg",
+		Container:    "dca",
+		VBR:          true,
+		Complexity:   10,
+		MaxBandwidth: "full",
+		RawOutput:    false,
+		RawStdin:     false,
+	}
+}
+
+// setDefaults fills in zero-valued numeric and string fields with the same
+// defaults the cmd/dca flag set uses, so a caller can pass a partially
+// populated EncodeOptions. Boolean fields such as VBR are left as given.
+func (o *EncodeOptions) setDefaults() {
+	std := StdEncodeOptions()
+
+	if o.Volume == 0 {
+		o.Volume = std.Volume
+	}
+	if o.Channels == 0 {
+		o.Channels = std.Channels
+	}
+	if o.FrameRate == 0 {
+		o.FrameRate = std.FrameRate
+	}
+	if o.FrameSize == 0 {
+		o.FrameSize = std.FrameSize
+	}
+	if o.Bitrate == 0 {
+		o.Bitrate = std.Bitrate
+	}
+	if o.Application == "" {
+		o.Application = std.Application
+	}
+	if o.CoverFormat == "" {
+		o.CoverFormat = std.CoverFormat
+	}
+	if o.Container == "" {
+		o.Container = std.Container
+	}
+	// Complexity is intentionally not defaulted here: unlike the other
+	// numeric fields, 0 is a valid, meaningful complexity (fastest, lowest
+	// quality), so there's no zero value we can treat as "unset" without
+	// also silently overriding an explicit -complexity 0. Callers who want
+	// the recommended complexity should start from StdEncodeOptions.
+	if o.MaxBandwidth == "" {
+		o.MaxBandwidth = std.MaxBandwidth
+	}
+}
+
+// Validate returns an error if the EncodeOptions contains values that the
+// Opus encoder cannot use.
+func (o *EncodeOptions) Validate() error {
+	if o.Bitrate < 1 || o.Bitrate > 512 {
+		return fmt.Errorf("dca: bitrate must be between 1 and 512, got %d", o.Bitrate)
+	}
+
+	switch o.Application {
+	case "voip", "audio", "lowdelay":
+	default:
+		return fmt.Errorf("dca: application must be voip, audio, or lowdelay, got %q", o.Application)
+	}
+
+	switch o.Container {
+	case "dca", "ogg":
+	default:
+		return fmt.Errorf("dca: container must be dca or ogg, got %q", o.Container)
+	}
+
+	if o.PacketLoss < 0 || o.PacketLoss > 100 {
+		return fmt.Errorf("dca: packet loss percentage must be between 0 and 100, got %d", o.PacketLoss)
+	}
+
+	if o.Complexity < 0 || o.Complexity > 10 {
+		return fmt.Errorf("dca: complexity must be between 0 and 10, got %d", o.Complexity)
+	}
+
+	switch o.MaxBandwidth {
+	case "narrow", "medium", "wide", "superwide", "full":
+	default:
+		return fmt.Errorf("dca: maxbandwidth must be narrow, medium, wide, superwide, or full, got %q", o.MaxBandwidth)
+	}
+
+	return nil
+}